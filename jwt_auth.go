@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/xid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultSignedURLTTL = time.Hour
+
+var jwtSigner *JWTSigner
+
+var (
+	JWT_SECRET               = getEnv("JWT_SECRET", "")
+	JWT_PUBLIC_KEY_PATH      = getEnv("JWT_PUBLIC_KEY_PATH", "")
+	JWT_PRIVATE_KEY_PATH     = getEnv("JWT_PRIVATE_KEY_PATH", "")
+	REQUIRE_SIGNED_DOWNLOADS = getEnv("REQUIRE_SIGNED_DOWNLOADS", "false") == "true"
+)
+
+// downloadClaims are the custom JWT claims embedded in a signed
+// download token.
+type downloadClaims struct {
+	jwt.RegisteredClaims
+	AssetID      string `json:"asset_id"`
+	IP           string `json:"ip,omitempty"`
+	MaxDownloads int    `json:"max_downloads,omitempty"`
+}
+
+// DownloadTokenUsage counts redemptions of a signed download token that
+// carries a max_downloads limit. Tokens without a limit never get a row.
+type DownloadTokenUsage struct {
+	JTI       string `gorm:"type:varchar(20);primary_key"`
+	UsedCount int    `gorm:"not null;default:0"`
+}
+
+// JWTSigner signs and verifies download tokens, using HS256 by default
+// or RS256 when JWT_PRIVATE_KEY_PATH/JWT_PUBLIC_KEY_PATH are set.
+type JWTSigner struct {
+	db        *gorm.DB
+	method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+}
+
+// NewJWTSigner builds a JWTSigner from the JWT_* env vars. It returns an
+// error if neither an HS256 secret nor an RS256 key pair is configured.
+func NewJWTSigner(db *gorm.DB) (*JWTSigner, error) {
+	if err := db.AutoMigrate(&DownloadTokenUsage{}); err != nil {
+		return nil, err
+	}
+
+	if JWT_PRIVATE_KEY_PATH != "" || JWT_PUBLIC_KEY_PATH != "" {
+		privPEM, err := os.ReadFile(JWT_PRIVATE_KEY_PATH)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT_PRIVATE_KEY_PATH: %w", err)
+		}
+		privKey, err := jwt.ParseRSAPrivateKeyFromPEM(privPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RS256 private key: %w", err)
+		}
+		pubPEM, err := os.ReadFile(JWT_PUBLIC_KEY_PATH)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT_PUBLIC_KEY_PATH: %w", err)
+		}
+		pubKey, err := jwt.ParseRSAPublicKeyFromPEM(pubPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RS256 public key: %w", err)
+		}
+		return &JWTSigner{db: db, method: jwt.SigningMethodRS256, signKey: privKey, verifyKey: pubKey}, nil
+	}
+
+	if JWT_SECRET == "" {
+		return nil, fmt.Errorf("JWT_SECRET or JWT_PRIVATE_KEY_PATH/JWT_PUBLIC_KEY_PATH is required to sign download URLs")
+	}
+	secret := []byte(JWT_SECRET)
+	return &JWTSigner{db: db, method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}, nil
+}
+
+// Sign issues a download token for assetID, valid for ttl, optionally
+// bound to clientIP and/or limited to maxDownloads redemptions.
+func (j *JWTSigner) Sign(assetID, clientIP string, ttl time.Duration, maxDownloads int) (string, error) {
+	now := time.Now().UTC()
+	claims := downloadClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        xid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		AssetID:      assetID,
+		IP:           clientIP,
+		MaxDownloads: maxDownloads,
+	}
+	return jwt.NewWithClaims(j.method, claims).SignedString(j.signKey)
+}
+
+// Verify parses and validates a download token for assetID, checking
+// expiration, IP binding and the max_downloads limit. On success it
+// records one more redemption when the token carries a limit.
+func (j *JWTSigner) Verify(tokenString, assetID, clientIP string) error {
+	var claims downloadClaims
+	token, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (any, error) {
+		if t.Method != j.method {
+			return nil, fmt.Errorf("unexpected signing method %q", t.Method.Alg())
+		}
+		return j.verifyKey, nil
+	})
+	if err != nil || !token.Valid {
+		return fmt.Errorf("invalid or expired download token")
+	}
+
+	if claims.AssetID != assetID {
+		return fmt.Errorf("token does not authorize this asset")
+	}
+	if claims.IP != "" && claims.IP != clientIP {
+		return fmt.Errorf("token is not valid for this client")
+	}
+	if claims.MaxDownloads > 0 {
+		return j.redeem(claims.ID, claims.MaxDownloads)
+	}
+	return nil
+}
+
+// redeem records one more redemption of jti, atomically rejecting once
+// maxDownloads is reached. The first-seen row is inserted with
+// ON CONFLICT DO NOTHING rather than FirstOrCreate, since two concurrent
+// redemptions of a brand-new jti would otherwise race on the Create half
+// of FirstOrCreate and surface a raw unique-violation error instead of
+// an ordinary quota check. The check and the increment then happen in a
+// single conditional UPDATE so two concurrent redemptions of the same
+// single-use token can't both pass a separate read-then-write check.
+func (j *JWTSigner) redeem(jti string, maxDownloads int) error {
+	if err := j.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&DownloadTokenUsage{JTI: jti}).Error; err != nil {
+		return err
+	}
+	result := j.db.Model(&DownloadTokenUsage{}).
+		Where("jti = ? AND used_count < ?", jti, maxDownloads).
+		UpdateColumn("used_count", gorm.Expr("used_count + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("download token has reached its max_downloads limit")
+	}
+	return nil
+}
+
+// signDownloadURLHandler implements POST /assets/:id/sign.
+func signDownloadURLHandler(c *gin.Context) {
+	if jwtSigner == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse(503, "Signed downloads are not configured"))
+		return
+	}
+
+	assetID := c.Param("id")
+	asset, err := assetService.getAssetByID(assetID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to retrieve asset"))
+		return
+	}
+	if asset == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse(404, "Asset not found"))
+		return
+	}
+
+	ttl := defaultSignedURLTTL
+	if ttlParam := c.Query("ttl"); ttlParam != "" {
+		if parsed, err := strconv.Atoi(ttlParam); err == nil && parsed > 0 {
+			ttl = time.Duration(parsed) * time.Second
+		}
+	}
+	maxDownloads := 0
+	if maxParam := c.Query("maxDownloads"); maxParam != "" {
+		if parsed, err := strconv.Atoi(maxParam); err == nil && parsed > 0 {
+			maxDownloads = parsed
+		}
+	}
+	clientIP := ""
+	if c.Query("bindIp") == "true" {
+		clientIP = c.ClientIP()
+	}
+
+	token, err := jwtSigner.Sign(asset.ID, clientIP, ttl, maxDownloads)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to sign download token"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"token":     token,
+		"expiresAt": time.Now().UTC().Add(ttl),
+		"url":       fmt.Sprintf("/assets/%s?token=%s", asset.FileName, token),
+	})
+}
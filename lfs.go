@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/xid"
+)
+
+const lfsTransferTTL = 15 * time.Minute
+
+// LFS_MAX_UPLOAD_SIZE caps a single PUT /lfs/:oid body. It defaults far
+// above MAX_UPLOAD_SIZE (the raw-upload cap) since Git LFS exists
+// specifically to ship the large binaries that cap is meant to keep off
+// the direct upload path.
+var LFS_MAX_UPLOAD_SIZE = int64(getEnvInt("LFS_MAX_UPLOAD_SIZE", 5<<30)) // 5 GiB
+
+// lfsClaims authorize a single PUT/GET against /lfs/:oid for a specific
+// LFS operation, reusing the JWTSigner used for signed asset downloads.
+type lfsClaims struct {
+	jwt.RegisteredClaims
+	OID       string `json:"oid"`
+	Operation string `json:"operation"`
+}
+
+func (j *JWTSigner) SignLFS(oid, operation string, ttl time.Duration) (string, error) {
+	now := time.Now().UTC()
+	claims := lfsClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		OID:       oid,
+		Operation: operation,
+	}
+	return jwt.NewWithClaims(j.method, claims).SignedString(j.signKey)
+}
+
+func (j *JWTSigner) VerifyLFS(tokenString, oid, operation string) error {
+	var claims lfsClaims
+	token, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (any, error) {
+		if t.Method != j.method {
+			return nil, fmt.Errorf("unexpected signing method %q", t.Method.Alg())
+		}
+		return j.verifyKey, nil
+	})
+	if err != nil || !token.Valid {
+		return fmt.Errorf("invalid or expired LFS transfer token")
+	}
+	if claims.OID != oid || claims.Operation != operation {
+		return fmt.Errorf("token does not authorize this transfer")
+	}
+	return nil
+}
+
+type lfsObjectRequest struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+type lfsBatchRequest struct {
+	Operation string             `json:"operation"`
+	Objects   []lfsObjectRequest `json:"objects"`
+}
+
+type lfsAction struct {
+	Href      string            `json:"href"`
+	Header    map[string]string `json:"header,omitempty"`
+	ExpiresIn int               `json:"expires_in"`
+}
+
+type lfsObjectResponse struct {
+	OID     string                `json:"oid"`
+	Size    int64                 `json:"size"`
+	Actions map[string]lfsAction  `json:"actions,omitempty"`
+	Error   *lfsObjectResponseErr `json:"error,omitempty"`
+}
+
+type lfsObjectResponseErr struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// lfsBatchHandler implements the Git LFS Batch API
+// (POST /{repo}.git/info/lfs/objects/batch), mapping LFS OIDs (sha256)
+// onto Asset rows so this server can act as an LFS backend for any Git
+// host.
+func lfsBatchHandler(c *gin.Context) {
+	if jwtSigner == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse(503, "LFS transfers require signed URL support to be configured"))
+		return
+	}
+
+	var req lfsBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse(422, "Invalid batch request"))
+		return
+	}
+	if req.Operation != "upload" && req.Operation != "download" {
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse(422, "operation must be \"upload\" or \"download\""))
+		return
+	}
+
+	objects := make([]lfsObjectResponse, 0, len(req.Objects))
+	for _, obj := range req.Objects {
+		if req.Operation == "download" {
+			objects = append(objects, lfsDownloadObject(obj))
+		} else {
+			objects = append(objects, lfsUploadObject(obj))
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"transfer": "basic",
+		"objects":  objects,
+	})
+}
+
+func lfsDownloadObject(obj lfsObjectRequest) lfsObjectResponse {
+	asset, err := assetService.getAssetBySHA256(obj.OID)
+	if err != nil || asset == nil {
+		return lfsObjectResponse{
+			OID:   obj.OID,
+			Size:  obj.Size,
+			Error: &lfsObjectResponseErr{Code: 404, Message: "Object does not exist"},
+		}
+	}
+
+	token, err := jwtSigner.SignLFS(obj.OID, "download", lfsTransferTTL)
+	if err != nil {
+		return lfsObjectResponse{
+			OID:   obj.OID,
+			Size:  obj.Size,
+			Error: &lfsObjectResponseErr{Code: 500, Message: "Failed to sign transfer"},
+		}
+	}
+
+	return lfsObjectResponse{
+		OID:  obj.OID,
+		Size: asset.Size,
+		Actions: map[string]lfsAction{
+			"download": {
+				Href:      "/lfs/" + obj.OID,
+				Header:    map[string]string{"Authorization": "Bearer " + token},
+				ExpiresIn: int(lfsTransferTTL.Seconds()),
+			},
+		},
+	}
+}
+
+func lfsUploadObject(obj lfsObjectRequest) lfsObjectResponse {
+	if asset, err := assetService.getAssetBySHA256(obj.OID); err == nil && asset != nil {
+		// Already have this content; no actions means the client can skip it.
+		return lfsObjectResponse{OID: obj.OID, Size: obj.Size}
+	}
+
+	token, err := jwtSigner.SignLFS(obj.OID, "upload", lfsTransferTTL)
+	if err != nil {
+		return lfsObjectResponse{
+			OID:   obj.OID,
+			Size:  obj.Size,
+			Error: &lfsObjectResponseErr{Code: 500, Message: "Failed to sign transfer"},
+		}
+	}
+
+	return lfsObjectResponse{
+		OID:  obj.OID,
+		Size: obj.Size,
+		Actions: map[string]lfsAction{
+			"upload": {
+				Href:      "/lfs/" + obj.OID,
+				Header:    map[string]string{"Authorization": "Bearer " + token},
+				ExpiresIn: int(lfsTransferTTL.Seconds()),
+			},
+		},
+	}
+}
+
+func bearerToken(c *gin.Context) string {
+	auth := c.GetHeader("Authorization")
+	return strings.TrimPrefix(auth, "Bearer ")
+}
+
+// lfsUploadHandler implements PUT /lfs/:oid, verifying the uploaded
+// bytes' SHA256 matches the advertised OID before finalizing the Asset.
+func lfsUploadHandler(c *gin.Context) {
+	if jwtSigner == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse(503, "LFS transfers require signed URL support to be configured"))
+		return
+	}
+
+	oid := c.Param("oid")
+	if err := jwtSigner.VerifyLFS(bearerToken(c), oid, "upload"); err != nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse(401, err.Error()))
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, LFS_MAX_UPLOAD_SIZE)
+
+	buffer := make([]byte, 512)
+	n, err := c.Request.Body.Read(buffer)
+	if err != nil && err != io.EOF {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to read request body"))
+		return
+	}
+	mtype := mimetype.Detect(buffer[:n])
+	bodyReader := io.MultiReader(bytes.NewReader(buffer[:n]), c.Request.Body)
+
+	assetID := xid.New().String()
+	destFileName := assetID + mtype.Extension()
+
+	ctx := c.Request.Context()
+	stagingKey, size, fileHash, sha256Hash, err := assetService.stageWithDigests(ctx, destFileName, bodyReader)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to write object"))
+		return
+	}
+
+	if sha256Hash != oid {
+		assetService.storage.Discard(ctx, stagingKey)
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse(422, "Uploaded content does not match the advertised oid"))
+		return
+	}
+
+	asset := &Asset{
+		ID:       assetID,
+		FileName: destFileName,
+		Size:     size,
+		MimeType: mtype.String(),
+		Hash:     fileHash,
+		SHA256:   sha256Hash,
+		RefCount: 1,
+	}
+	if _, _, err := assetService.finalizeStagedUpload(ctx, stagingKey, asset); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to save object metadata"))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// lfsDownloadHandler implements GET /lfs/:oid.
+func lfsDownloadHandler(c *gin.Context) {
+	if jwtSigner == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse(503, "LFS transfers require signed URL support to be configured"))
+		return
+	}
+
+	oid := c.Param("oid")
+	if err := jwtSigner.VerifyLFS(bearerToken(c), oid, "download"); err != nil {
+		c.JSON(http.StatusUnauthorized, ErrorResponse(401, err.Error()))
+		return
+	}
+
+	asset, err := assetService.getAssetBySHA256(oid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to retrieve object"))
+		return
+	}
+	if asset == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse(404, "Object does not exist"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	if url, err := assetService.storage.PresignedURL(ctx, asset.StoragePath, asset.FileName); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to sign object URL"))
+		return
+	} else if url != "" {
+		c.Redirect(http.StatusFound, url)
+		return
+	}
+
+	reader, err := assetService.storage.Open(ctx, asset.StoragePath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse(404, "Object not found on storage"))
+		return
+	}
+	defer reader.Close()
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", oid))
+	c.DataFromReader(http.StatusOK, asset.Size, asset.MimeType, reader, nil)
+}
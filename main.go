@@ -2,27 +2,27 @@ package main
 
 import (
 	"bytes"
-	"crypto/md5"
+	"context"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/rs/xid"
-	"golang.org/x/sync/errgroup"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
@@ -41,20 +41,22 @@ var (
 )
 
 type Asset struct {
-	ID          string    `json:"id" gorm:"type:varchar(20);primary_key"`
-	StoragePath string    `json:"-" gorm:"not null"`
-	FileName    string    `json:"fileName,omitempty" gorm:"not null"`
-	Size        int64     `json:"size" gorm:"not null"`
-	MimeType    string    `json:"mimeType" gorm:"not null"`
-	Hash        string    `json:"hash,omitempty" gorm:"index"`
-	CreatedAt   time.Time `json:"createdAt" gorm:"autoCreateTime"`
-	UpdatedAt   time.Time `json:"updatedAt" gorm:"autoUpdateTime"`
+	ID            string    `json:"id" gorm:"type:varchar(20);primary_key"`
+	StoragePath   string    `json:"-" gorm:"not null"`
+	FileName      string    `json:"fileName,omitempty" gorm:"not null"`
+	Size          int64     `json:"size" gorm:"not null"`
+	MimeType      string    `json:"mimeType" gorm:"not null"`
+	Hash          string    `json:"hash,omitempty" gorm:"uniqueIndex"`
+	SHA256        string    `json:"sha256,omitempty" gorm:"index"`
+	RefCount      int       `json:"-" gorm:"not null;default:1"`
+	ThumbnailPath string    `json:"-"`
+	CreatedAt     time.Time `json:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time `json:"updatedAt" gorm:"autoUpdateTime"`
 }
 
 type AssetService struct {
-	db               *gorm.DB
-	mu               sync.Mutex
-	directoryCounter *sync.Map
+	db      *gorm.DB
+	storage StorageProvider
 }
 
 func getEnv(key, fallback string) string {
@@ -64,15 +66,21 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+func getEnvInt(key string, fallback int) int {
+	if value, exists := os.LookupEnv(key); exists {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return fallback
+}
+
 var assetService *AssetService
 
 func main() {
 	if DATABASE_URL == "" {
 		log.Fatal("DATABASE_URL environment variable is required")
 	}
-	if STORAGE_PATH == "" {
-		log.Fatal("STORAGE_PATH environment variable is required")
-	}
 	if API_KEY == "" {
 		log.Fatal("API_KEY environment variable is required")
 	}
@@ -101,17 +109,46 @@ func main() {
 	if err := db.AutoMigrate(&Asset{}); err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
+	storage, err := NewStorageProvider(STORAGE_DRIVER)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage driver %q: %v", STORAGE_DRIVER, err)
+	}
+	if local, ok := storage.(*LocalStorageProvider); ok {
+		if err := local.InitDirectoryCounters(db); err != nil {
+			log.Printf("Warning: Failed to initialize directory counters: %v", err)
+		}
+	}
+
 	assetService = &AssetService{
-		db:               db,
-		directoryCounter: &sync.Map{},
+		db:      db,
+		storage: storage,
 	}
 
-	if err := assetService.initDirectoryCounters(); err != nil {
-		log.Printf("Warning: Failed to initialize directory counters: %v", err)
+	if STORAGE_DRIVER_REPLICA != "" {
+		replicaStorage, err = NewStorageProvider(STORAGE_DRIVER_REPLICA)
+		if err != nil {
+			log.Fatalf("Failed to initialize replica storage driver %q: %v", STORAGE_DRIVER_REPLICA, err)
+		}
+	}
+
+	taskService, err = NewTaskService(db)
+	if err != nil {
+		log.Fatalf("Failed to initialize task service: %v", err)
 	}
+	taskService.Start(context.Background())
 
-	if _, err := os.Stat(STORAGE_PATH); os.IsNotExist(err) {
-		log.Fatal("rClone mount path does not exist: ", STORAGE_PATH)
+	tusService, err = NewTusService(db)
+	if err != nil {
+		log.Fatalf("Failed to initialize tus upload service: %v", err)
+	}
+	go tusService.reapExpired(context.Background())
+
+	jwtSigner, err = NewJWTSigner(db)
+	if err != nil {
+		if REQUIRE_SIGNED_DOWNLOADS {
+			log.Fatalf("Failed to initialize JWT signer: %v", err)
+		}
+		log.Printf("Warning: signed download URLs unavailable: %v", err)
 	}
 
 	router := gin.Default()
@@ -130,45 +167,30 @@ func main() {
 	api := router.Group("/")
 	api.PUT("/upload", APIKeyAuth(), assetService.handleRawUpload)
 	api.GET("/assets", APIKeyAuth(), assetService.listAssets)
+	api.GET("/assets/by-hash/:hash", APIKeyAuth(), assetService.getAssetByHashHandler)
+	api.GET("/assets/:name/thumbnail", assetService.downloadThumbnail)
 	api.DELETE("/assets/:id", APIKeyAuth(), assetService.deleteAsset)
+	api.POST("/assets/:id/sign", APIKeyAuth(), signDownloadURLHandler)
 	api.GET("/assets/:name", assetService.downloadAsset)
+	api.GET("/tasks", APIKeyAuth(), listTasksHandler)
+	api.GET("/tasks/:id", APIKeyAuth(), getTaskHandler)
+
+	files := router.Group("/files", APIKeyAuth())
+	files.OPTIONS("", tusService.optionsUploadHandler)
+	files.POST("", tusService.createUploadHandler)
+	files.HEAD("/:id", tusService.headUploadHandler)
+	files.PATCH("/:id", tusService.patchUploadHandler)
+	files.DELETE("/:id", tusService.terminateUploadHandler)
+
+	api.POST("/:repo/info/lfs/objects/batch", APIKeyAuth(), lfsBatchHandler)
+	api.PUT("/lfs/:oid", lfsUploadHandler)
+	api.GET("/lfs/:oid", lfsDownloadHandler)
 
 	log.Printf("Starting asset API server on port %s", PORT)
 	if err := router.Run(":" + PORT); err != nil {
 		log.Fatal("Failed to start server: ", err)
 	}
 }
-func (s *AssetService) initDirectoryCounters() error {
-	var assets []Asset
-	result := s.db.Select("storage_path").Find(&assets)
-	if result.Error != nil {
-		return result.Error
-	}
-
-	var g errgroup.Group
-
-	g.SetLimit(8)
-
-	for _, asset := range assets {
-		g.Go(func() error {
-			dir := filepath.Dir(asset.StoragePath)
-			actual, _ := s.directoryCounter.LoadOrStore(dir, new(atomic.Int64))
-			counter := actual.(*atomic.Int64)
-			counter.Add(1)
-			return nil
-		})
-	}
-	g.Wait()
-	numDirectories := 0
-	s.directoryCounter.Range(func(key, value any) bool {
-		numDirectories++
-		return true
-	})
-
-	log.Printf("Initialized directory counters, tracking %d directories", numDirectories)
-	return nil
-}
-
 func APIKeyAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		apiKey := c.GetHeader("X-API-Key")
@@ -212,11 +234,11 @@ func healthCheck(c *gin.Context) {
 		return
 	}
 
-	if _, err := os.Stat(STORAGE_PATH); os.IsNotExist(err) {
+	if err := assetService.storage.Healthy(c.Request.Context()); err != nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
 			"status": "unhealthy",
 			"time":   time.Now().Format(time.RFC3339),
-			"error":  "rClone mount not available",
+			"error":  "Storage backend not available",
 		})
 		return
 	}
@@ -229,37 +251,17 @@ func healthCheck(c *gin.Context) {
 	})
 }
 
-func (s *AssetService) getSmartStoragePath(assetID string) string {
-	hash := md5.Sum([]byte(assetID))
-	hexHash := hex.EncodeToString(hash[:])
-
-	parts := make([]string, 0, DIR_SHARDING_DEPTH)
-	for i := 0; i < DIR_SHARDING_DEPTH && i*2 < len(hexHash); i++ {
-		parts = append(parts, hexHash[i*2:i*2+2])
-	}
-
-	basePath := filepath.Join(parts...)
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	baseCounterVal, _ := s.directoryCounter.LoadOrStore(basePath, new(atomic.Int64))
-	baseCounter := baseCounterVal.(*atomic.Int64)
-	currentBaseCount := baseCounter.Load()
-
-	if currentBaseCount >= FILES_PER_DIR {
-		for i := range 100 {
-			newPath := filepath.Join(basePath, fmt.Sprintf("bucket_%d", i))
-			bucketCounterVal, _ := s.directoryCounter.LoadOrStore(newPath, new(atomic.Int64))
-			bucketCounter := bucketCounterVal.(*atomic.Int64)
-			currentBucketCount := bucketCounter.Load()
-
-			if currentBucketCount < FILES_PER_DIR {
-				bucketCounter.Add(1)
-				return newPath
-			}
-		}
+// stageWithDigests stages r through the storage driver while also
+// computing its SHA256 in the same pass, so callers get both the MD5
+// the driver already hashes and the SHA256 Git LFS needs without a
+// second read of the body.
+func (s *AssetService) stageWithDigests(ctx context.Context, name string, r io.Reader) (stagingKey string, size int64, md5Hash string, sha256Hash string, err error) {
+	shaWriter := sha256.New()
+	stagingKey, size, md5Hash, err = s.storage.Stage(ctx, name, io.TeeReader(r, shaWriter))
+	if err != nil {
+		return "", 0, "", "", err
 	}
-	baseCounter.Add(1)
-	return basePath
+	return stagingKey, size, md5Hash, hex.EncodeToString(shaWriter.Sum(nil)), nil
 }
 
 func (s *AssetService) saveAssetMetadata(asset *Asset) error {
@@ -281,6 +283,141 @@ func (s *AssetService) getAssetByID(id string) (*Asset, error) {
 	return &asset, nil
 }
 
+func (s *AssetService) getAssetByHash(hash string) (*Asset, error) {
+	var asset Asset
+	result := s.db.First(&asset, "hash = ?", hash)
+
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+
+	return &asset, nil
+}
+
+func (s *AssetService) getAssetBySHA256(sha256Hash string) (*Asset, error) {
+	var asset Asset
+	result := s.db.First(&asset, "sha256 = ?", sha256Hash)
+
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+
+	return &asset, nil
+}
+
+func (s *AssetService) incrementAssetRefCount(id string) error {
+	result := s.db.Model(&Asset{}).Where("id = ?", id).UpdateColumn("ref_count", gorm.Expr("ref_count + 1"))
+	return result.Error
+}
+
+// setThumbnailPath records where thumbnailJob staged a generated preview
+// so downloadThumbnail can later serve it.
+func (s *AssetService) setThumbnailPath(assetID, storagePath string) error {
+	result := s.db.Model(&Asset{}).Where("id = ?", assetID).UpdateColumn("thumbnail_path", storagePath)
+	return result.Error
+}
+
+// decrementAssetRefCount atomically decrements ref_count and reports the
+// count left after the decrement, via a single UPDATE ... RETURNING.
+// Returning the post-decrement count (rather than the caller's stale
+// pre-decrement read) closes the race where two concurrent deletes both
+// see ref_count == 2 and both merely decrement, so neither ever reaches
+// the "last reference" branch that actually frees the asset.
+func (s *AssetService) decrementAssetRefCount(id string) (int, error) {
+	var asset Asset
+	result := s.db.Clauses(clause.Returning{Columns: []clause.Column{{Name: "ref_count"}}}).
+		Model(&asset).
+		Where("id = ?", id).
+		UpdateColumn("ref_count", gorm.Expr("ref_count - 1"))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return asset.RefCount, nil
+}
+
+// isUniqueViolation reports whether err is a Postgres unique constraint
+// violation (SQLSTATE 23505).
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// createAssetOrDedup inserts asset, treating a unique violation on Hash
+// as a concurrent duplicate upload rather than an error: the storage
+// object already promoted under asset.StoragePath is discarded and the
+// winning row's ref count is bumped instead. This closes the race where
+// two uploads of identical content both pass the pre-insert
+// getAssetByHash check before either commits.
+func (s *AssetService) createAssetOrDedup(ctx context.Context, asset *Asset) (result *Asset, deduplicated bool, err error) {
+	if err := s.saveAssetMetadata(asset); err != nil {
+		if !isUniqueViolation(err) {
+			return nil, false, err
+		}
+		if discardErr := s.storage.Delete(ctx, asset.StoragePath); discardErr != nil {
+			return nil, false, discardErr
+		}
+		winner, lookupErr := s.getAssetByHash(asset.Hash)
+		if lookupErr != nil {
+			return nil, false, lookupErr
+		}
+		if winner == nil {
+			return nil, false, fmt.Errorf("asset with hash %s vanished after unique violation", asset.Hash)
+		}
+		if err := s.incrementAssetRefCount(winner.ID); err != nil {
+			return nil, false, err
+		}
+		return winner, true, nil
+	}
+	return asset, false, nil
+}
+
+// finalizeStagedUpload is the common tail shared by every upload path
+// (raw PUT, tus, LFS) once a body has been staged and hashed: look up
+// asset by content hash and, if one already exists, discard the staging
+// copy and bump its ref count; otherwise promote the staging file to its
+// final location, persist the Asset row (falling back to the dedup path
+// if a concurrent upload of the same content won the race), and enqueue
+// its post-upload tasks. Callers fill in everything about asset except
+// StoragePath, which this method sets once Promote succeeds.
+func (s *AssetService) finalizeStagedUpload(ctx context.Context, stagingKey string, asset *Asset) (result *Asset, deduplicated bool, err error) {
+	existing, err := s.getAssetByHash(asset.Hash)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		if err := s.storage.Discard(ctx, stagingKey); err != nil {
+			return nil, false, err
+		}
+		if err := s.incrementAssetRefCount(existing.ID); err != nil {
+			return nil, false, err
+		}
+		return existing, true, nil
+	}
+
+	storagePath, err := s.storage.Promote(ctx, stagingKey, asset.FileName)
+	if err != nil {
+		return nil, false, err
+	}
+	asset.StoragePath = storagePath
+
+	final, deduplicated, err := s.createAssetOrDedup(ctx, asset)
+	if err != nil {
+		return nil, false, err
+	}
+	if deduplicated {
+		return final, true, nil
+	}
+
+	enqueuePostUploadTasks(final)
+	return final, false, nil
+}
+
 func (s *AssetService) deleteAssetMetadata(id string) error {
 	result := s.db.Delete(&Asset{}, "id = ?", id)
 	return result.Error
@@ -303,14 +440,6 @@ func (s *AssetService) handleRawUpload(c *gin.Context) {
 
 	assetID := xid.New().String()
 
-	storagePath := assetService.getSmartStoragePath(assetID)
-
-	fullDirPath := filepath.Join(STORAGE_PATH, storagePath)
-	if err := os.MkdirAll(fullDirPath, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to create directory"))
-		return
-	}
-
 	buffer := make([]byte, 512)
 	n, err := c.Request.Body.Read(buffer)
 	if err != nil && err != io.EOF {
@@ -320,43 +449,81 @@ func (s *AssetService) handleRawUpload(c *gin.Context) {
 
 	mtype := mimetype.Detect(buffer[:n])
 	destFileName := assetID + mtype.Extension()
-	filePath := filepath.Join(fullDirPath, destFileName)
+	bodyReader := io.MultiReader(bytes.NewReader(buffer[:n]), c.Request.Body)
 
-	out, err := os.Create(filePath)
+	ctx := c.Request.Context()
+	stagingKey, size, fileHash, sha256Hash, err := assetService.stageWithDigests(ctx, destFileName, bodyReader)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to create file"))
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to write file"))
 		return
 	}
-	defer out.Close()
 
-	bodyReader := io.MultiReader(bytes.NewReader(buffer[:n]), c.Request.Body)
-
-	hashWriter := md5.New()
-	teeReader := io.TeeReader(bodyReader, hashWriter)
-
-	size, err := io.Copy(out, teeReader)
+	asset := &Asset{
+		ID:       assetID,
+		FileName: destFileName,
+		Size:     size,
+		MimeType: mtype.String(),
+		Hash:     fileHash,
+		SHA256:   sha256Hash,
+		RefCount: 1,
+	}
+	final, deduplicated, err := assetService.finalizeStagedUpload(ctx, stagingKey, asset)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to write file"))
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to finalize upload"))
+		return
+	}
+	if deduplicated {
+		c.JSON(http.StatusOK, gin.H{
+			"success":      true,
+			"deduplicated": true,
+			"asset":        *final,
+		})
 		return
 	}
 
-	fileHash := hex.EncodeToString(hashWriter.Sum(nil)) // Get the MD5 hash
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"asset":   *final,
+	})
+}
 
-	asset := &Asset{
-		ID:          assetID,
-		StoragePath: storagePath,
-		FileName:    destFileName,
-		Size:        size,
-		MimeType:    mtype.String(),
-		Hash:        fileHash,
+// enqueuePostUploadTasks schedules background processing for a newly
+// stored (non-deduplicated) asset. Enqueue failures are logged rather
+// than surfaced to the client: the asset itself is already durably
+// written, and tasks can be retried independently.
+func enqueuePostUploadTasks(asset *Asset) {
+	if _, err := taskService.Enqueue(TaskTypeMimeCheck, asset.ID); err != nil {
+		log.Printf("Warning: failed to enqueue mime check task for asset %s: %v", asset.ID, err)
+	}
+	if strings.HasPrefix(asset.MimeType, "image/") {
+		if _, err := taskService.Enqueue(TaskTypeThumbnail, asset.ID); err != nil {
+			log.Printf("Warning: failed to enqueue thumbnail task for asset %s: %v", asset.ID, err)
+		}
+	}
+	if strings.HasPrefix(asset.MimeType, "video/") {
+		if _, err := taskService.Enqueue(TaskTypeMetadata, asset.ID); err != nil {
+			log.Printf("Warning: failed to enqueue metadata task for asset %s: %v", asset.ID, err)
+		}
+	}
+	if _, err := taskService.Enqueue(TaskTypeReplicate, asset.ID); err != nil {
+		log.Printf("Warning: failed to enqueue replicate task for asset %s: %v", asset.ID, err)
 	}
+}
 
-	if err := assetService.saveAssetMetadata(asset); err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to save asset metadata"))
+func (s *AssetService) getAssetByHashHandler(c *gin.Context) {
+	hash := c.Param("hash")
+	asset, err := assetService.getAssetByHash(hash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to retrieve asset"))
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
+	if asset == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse(404, "Asset not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"asset":   *asset,
 	})
@@ -416,16 +583,88 @@ func (s *AssetService) downloadAsset(c *gin.Context) {
 		c.JSON(http.StatusNotFound, ErrorResponse(404, "Asset not found"))
 		return
 	}
-	filePath := filepath.Join(STORAGE_PATH, asset.StoragePath, assetName)
 
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	token := c.Query("token")
+	if token == "" {
+		if REQUIRE_SIGNED_DOWNLOADS {
+			c.JSON(http.StatusUnauthorized, ErrorResponse(401, "A signed download token is required"))
+			return
+		}
+	} else {
+		if jwtSigner == nil {
+			c.JSON(http.StatusServiceUnavailable, ErrorResponse(503, "Signed downloads are not configured"))
+			return
+		}
+		if err := jwtSigner.Verify(token, asset.ID, c.ClientIP()); err != nil {
+			c.JSON(http.StatusUnauthorized, ErrorResponse(401, err.Error()))
+			return
+		}
+	}
+
+	if url, err := assetService.storage.PresignedURL(c.Request.Context(), asset.StoragePath, assetName); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to sign asset URL"))
+		return
+	} else if url != "" {
+		c.Redirect(http.StatusFound, url)
+		return
+	}
+
+	reader, err := assetService.storage.Open(c.Request.Context(), asset.StoragePath)
+	if err != nil {
 		c.JSON(http.StatusNotFound, ErrorResponse(404, "Asset file not found on storage"))
 		return
 	}
+	defer reader.Close()
+
 	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%s", assetName))
 	c.Header("Cache-Control", "max-age=2592000")
+	c.DataFromReader(http.StatusOK, asset.Size, asset.MimeType, reader, nil)
+}
+
+// downloadThumbnail implements GET /assets/:name/thumbnail, serving the
+// preview thumbnailJob generated for an image asset. It 404s if the
+// asset has none, either because it isn't an image or the thumbnail task
+// hasn't completed yet.
+func (s *AssetService) downloadThumbnail(c *gin.Context) {
+	assetName := c.Param("name")
+	assetID := strings.Split(assetName, ".")[0]
+	if _, err := xid.FromString(assetID); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse(400, "Invalid asset ID format"))
+		return
+	}
+	asset, err := assetService.getAssetByID(assetID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to retrieve asset"))
+		return
+	}
+	if asset == nil || asset.ThumbnailPath == "" {
+		c.JSON(http.StatusNotFound, ErrorResponse(404, "Thumbnail not found"))
+		return
+	}
 
-	c.File(filePath)
+	ctx := c.Request.Context()
+	if url, err := assetService.storage.PresignedURL(ctx, asset.ThumbnailPath, assetID+"_thumb.jpg"); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to sign thumbnail URL"))
+		return
+	} else if url != "" {
+		c.Redirect(http.StatusFound, url)
+		return
+	}
+
+	info, err := assetService.storage.Stat(ctx, asset.ThumbnailPath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse(404, "Thumbnail not found on storage"))
+		return
+	}
+	reader, err := assetService.storage.Open(ctx, asset.ThumbnailPath)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse(404, "Thumbnail not found on storage"))
+		return
+	}
+	defer reader.Close()
+
+	c.Header("Cache-Control", "max-age=2592000")
+	c.DataFromReader(http.StatusOK, info.Size, "image/jpeg", reader, nil)
 }
 
 func (s *AssetService) deleteAsset(c *gin.Context) {
@@ -447,8 +686,19 @@ func (s *AssetService) deleteAsset(c *gin.Context) {
 		return
 	}
 
-	filePath := filepath.Join(STORAGE_PATH, asset.StoragePath, asset.FileName)
-	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+	remaining, err := assetService.decrementAssetRefCount(assetID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to update asset reference count"))
+		return
+	}
+	if remaining > 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+		})
+		return
+	}
+
+	if err := assetService.storage.Delete(c.Request.Context(), asset.StoragePath); err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to delete asset file"))
 		return
 	}
@@ -458,17 +708,6 @@ func (s *AssetService) deleteAsset(c *gin.Context) {
 		return
 	}
 
-	s.mu.Lock()
-	dirPath := asset.StoragePath
-	if actual, ok := assetService.directoryCounter.Load(dirPath); ok {
-		if counter, ok := actual.(*atomic.Int64); ok {
-			if counter.Load() > 0 {
-				counter.Add(-1)
-			}
-		}
-	}
-	s.mu.Unlock()
-
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 	})
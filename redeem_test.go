@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestJWTSignerRedeem_MaxDownloadsEnforcedUnderConcurrency(t *testing.T) {
+	db := newTestDB(t)
+	signer := &JWTSigner{db: db}
+
+	const jti = "token1"
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = signer.redeem(jti, 1)
+		}(i)
+	}
+	wg.Wait()
+
+	successes := 0
+	for _, err := range errs {
+		if err == nil {
+			successes++
+		}
+	}
+	if successes != 1 {
+		t.Fatalf("expected exactly one of two concurrent redemptions of a max_downloads=1 token to succeed, got %d (errs=%v)", successes, errs)
+	}
+}
+
+// TestJWTSignerRedeem_FreshTokenWithSpareQuotaNeverErrors guards against
+// the insert race in the first-seen-jti path: concurrent redemptions of
+// a brand-new token that has plenty of spare quota must all succeed,
+// never surface a raw unique-violation error from racing on the usage
+// row's creation.
+func TestJWTSignerRedeem_FreshTokenWithSpareQuotaNeverErrors(t *testing.T) {
+	db := newTestDB(t)
+	signer := &JWTSigner{db: db}
+
+	const jti = "fresh-token"
+	const concurrency = 5
+	var wg sync.WaitGroup
+	errs := make([]error, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = signer.redeem(jti, concurrency)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("redeem %d of a fresh token with spare quota should not have errored, got: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ObjectInfo describes a stored object as reported by a StorageProvider,
+// independent of whether the backing store is a filesystem or an object
+// store.
+type ObjectInfo struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// StorageProvider abstracts the raw byte storage used for Asset payloads.
+// Asset.StoragePath is an opaque key understood only by the driver that
+// created it; callers must not assume it is a filesystem path.
+type StorageProvider interface {
+	// Stage writes r to a temporary location near where name would
+	// ultimately live and returns a staging key, the payload size and its
+	// MD5 hash (hex-encoded). The hash is only known once the stream has
+	// been fully consumed, so callers decide whether to Promote or
+	// Discard the staged object after inspecting it.
+	Stage(ctx context.Context, name string, r io.Reader) (stagingKey string, size int64, hash string, err error)
+	// Promote finalizes a previously staged object under finalName,
+	// returning the key that must be persisted as Asset.StoragePath.
+	Promote(ctx context.Context, stagingKey, finalName string) (key string, err error)
+	// Discard removes a staged object that turned out to be unneeded,
+	// e.g. because its content already exists under a different key.
+	Discard(ctx context.Context, stagingKey string) error
+	// Open returns a reader for the object stored under key.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object stored under key. It must not return an
+	// error when the object is already gone.
+	Delete(ctx context.Context, key string) error
+	// Stat returns metadata for the object stored under key.
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// PresignedURL returns a URL the caller can redirect a client to in
+	// order to download the object directly from the backing store. It
+	// returns an empty string when the driver has no such concept (e.g.
+	// the local driver), in which case the caller should stream via Open.
+	PresignedURL(ctx context.Context, key, filename string) (string, error)
+	// Healthy reports whether the backing store is currently reachable.
+	Healthy(ctx context.Context) error
+}
+
+var (
+	STORAGE_DRIVER         = getEnv("STORAGE_DRIVER", "local")
+	STORAGE_DRIVER_REPLICA = getEnv("STORAGE_DRIVER_REPLICA", "")
+)
+
+// replicaStorage is the optional secondary StorageProvider that
+// replicateJob copies assets into. It is nil unless
+// STORAGE_DRIVER_REPLICA is set.
+var replicaStorage StorageProvider
+
+// NewStorageProvider builds the StorageProvider selected by driver
+// ("local" or "s3"). The local driver reads STORAGE_PATH; the S3 driver
+// reads the S3_* env vars.
+func NewStorageProvider(driver string) (StorageProvider, error) {
+	switch driver {
+	case "", "local":
+		return NewLocalStorageProvider(STORAGE_PATH)
+	case "s3":
+		return NewS3StorageProvider()
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
+}
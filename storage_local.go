@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
+)
+
+// LocalStorageProvider stores assets on disk under basePath, typically an
+// rclone mount. It shards files across subdirectories; once a shard holds
+// FILES_PER_DIR entries, new files spill into up to 100 bucket_N
+// subdirectories of it, and when those are full too they go back into the
+// shard directory itself.
+type LocalStorageProvider struct {
+	basePath         string
+	mu               sync.Mutex
+	directoryCounter *sync.Map
+}
+
+// NewLocalStorageProvider builds a LocalStorageProvider rooted at basePath.
+// basePath must already exist (e.g. an rclone mount).
+func NewLocalStorageProvider(basePath string) (*LocalStorageProvider, error) {
+	if basePath == "" {
+		return nil, fmt.Errorf("STORAGE_PATH environment variable is required")
+	}
+	if _, err := os.Stat(basePath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("rClone mount path does not exist: %s", basePath)
+	}
+	return &LocalStorageProvider{
+		basePath:         basePath,
+		directoryCounter: &sync.Map{},
+	}, nil
+}
+
+// InitDirectoryCounters rebuilds the in-memory per-directory file counts
+// from the asset keys already recorded in db, so sharding decisions made
+// after a restart stay consistent with what is actually on disk.
+func (l *LocalStorageProvider) InitDirectoryCounters(db *gorm.DB) error {
+	var assets []Asset
+	result := db.Select("storage_path").Find(&assets)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	var g errgroup.Group
+	g.SetLimit(8)
+
+	for _, asset := range assets {
+		g.Go(func() error {
+			dir := filepath.Dir(asset.StoragePath)
+			actual, _ := l.directoryCounter.LoadOrStore(dir, new(atomic.Int64))
+			counter := actual.(*atomic.Int64)
+			counter.Add(1)
+			return nil
+		})
+	}
+	g.Wait()
+
+	numDirectories := 0
+	l.directoryCounter.Range(func(key, value any) bool {
+		numDirectories++
+		return true
+	})
+	log.Printf("Initialized directory counters, tracking %d directories", numDirectories)
+	return nil
+}
+
+func (l *LocalStorageProvider) getSmartStoragePath(name string) string {
+	hash := md5.Sum([]byte(name))
+	hexHash := hex.EncodeToString(hash[:])
+
+	parts := make([]string, 0, DIR_SHARDING_DEPTH)
+	for i := 0; i < DIR_SHARDING_DEPTH && i*2 < len(hexHash); i++ {
+		parts = append(parts, hexHash[i*2:i*2+2])
+	}
+
+	basePath := filepath.Join(parts...)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	baseCounterVal, _ := l.directoryCounter.LoadOrStore(basePath, new(atomic.Int64))
+	baseCounter := baseCounterVal.(*atomic.Int64)
+	currentBaseCount := baseCounter.Load()
+
+	if currentBaseCount >= FILES_PER_DIR {
+		for i := range 100 {
+			newPath := filepath.Join(basePath, fmt.Sprintf("bucket_%d", i))
+			bucketCounterVal, _ := l.directoryCounter.LoadOrStore(newPath, new(atomic.Int64))
+			bucketCounter := bucketCounterVal.(*atomic.Int64)
+			currentBucketCount := bucketCounter.Load()
+
+			if currentBucketCount < FILES_PER_DIR {
+				bucketCounter.Add(1)
+				return newPath
+			}
+		}
+	}
+	baseCounter.Add(1)
+	return basePath
+}
+
+// Stage writes r to a dotfile in the same directory name would ultimately
+// be sharded into, so that a later Promote is a same-directory rename(2)
+// rather than a cross-directory copy.
+func (l *LocalStorageProvider) Stage(ctx context.Context, name string, r io.Reader) (string, int64, string, error) {
+	dir := l.getSmartStoragePath(name)
+	fullDirPath := filepath.Join(l.basePath, dir)
+	if err := os.MkdirAll(fullDirPath, 0755); err != nil {
+		return "", 0, "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	key := filepath.Join(dir, "."+name+".tmp")
+	out, err := os.Create(filepath.Join(l.basePath, key))
+	if err != nil {
+		return "", 0, "", fmt.Errorf("failed to create file: %w", err)
+	}
+	defer out.Close()
+
+	hashWriter := md5.New()
+	size, err := io.Copy(out, io.TeeReader(r, hashWriter))
+	if err != nil {
+		return "", 0, "", fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return key, size, hex.EncodeToString(hashWriter.Sum(nil)), nil
+}
+
+func (l *LocalStorageProvider) Promote(ctx context.Context, stagingKey, finalName string) (string, error) {
+	finalKey := filepath.Join(filepath.Dir(stagingKey), finalName)
+	if err := os.Rename(filepath.Join(l.basePath, stagingKey), filepath.Join(l.basePath, finalKey)); err != nil {
+		return "", fmt.Errorf("failed to promote staged file: %w", err)
+	}
+	return finalKey, nil
+}
+
+func (l *LocalStorageProvider) Discard(ctx context.Context, stagingKey string) error {
+	return l.Delete(ctx, stagingKey)
+}
+
+func (l *LocalStorageProvider) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(l.basePath, key))
+}
+
+func (l *LocalStorageProvider) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(filepath.Join(l.basePath, key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	dir := filepath.Dir(key)
+	if actual, ok := l.directoryCounter.Load(dir); ok {
+		if counter, ok := actual.(*atomic.Int64); ok && counter.Load() > 0 {
+			counter.Add(-1)
+		}
+	}
+	return nil
+}
+
+func (l *LocalStorageProvider) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	info, err := os.Stat(filepath.Join(l.basePath, key))
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// PresignedURL is unsupported by the local driver; callers should stream
+// the object via Open instead.
+func (l *LocalStorageProvider) PresignedURL(ctx context.Context, key, filename string) (string, error) {
+	return "", nil
+}
+
+func (l *LocalStorageProvider) Healthy(ctx context.Context) error {
+	if _, err := os.Stat(l.basePath); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+var (
+	S3_ENDPOINT   = getEnv("S3_ENDPOINT", "")
+	S3_BUCKET     = getEnv("S3_BUCKET", "")
+	S3_ACCESS_KEY = getEnv("S3_ACCESS_KEY", "")
+	S3_SECRET_KEY = getEnv("S3_SECRET_KEY", "")
+	S3_USE_SSL    = getEnv("S3_USE_SSL", "true")
+
+	presignedURLExpiry = 15 * time.Minute
+)
+
+// S3StorageProvider stores assets in an S3-compatible object store (AWS S3,
+// MinIO, etc.), streaming payloads directly to the bucket instead of
+// touching the local disk.
+type S3StorageProvider struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3StorageProvider builds an S3StorageProvider from the S3_* environment
+// variables.
+func NewS3StorageProvider() (*S3StorageProvider, error) {
+	if S3_ENDPOINT == "" || S3_BUCKET == "" || S3_ACCESS_KEY == "" || S3_SECRET_KEY == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY are required when STORAGE_DRIVER=s3")
+	}
+
+	client, err := minio.New(S3_ENDPOINT, &minio.Options{
+		Creds:  credentials.NewStaticV4(S3_ACCESS_KEY, S3_SECRET_KEY, ""),
+		Secure: S3_USE_SSL != "false",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	return &S3StorageProvider{client: client, bucket: S3_BUCKET}, nil
+}
+
+// Stage uploads r under a staging/ prefix. S3 has no rename, so Promote
+// copies the object to its final key and removes the staging object.
+func (s *S3StorageProvider) Stage(ctx context.Context, name string, r io.Reader) (string, int64, string, error) {
+	stagingKey := "staging/" + name
+
+	hashWriter := md5.New()
+	info, err := s.client.PutObject(ctx, s.bucket, stagingKey, io.TeeReader(r, hashWriter), -1, minio.PutObjectOptions{})
+	if err != nil {
+		return "", 0, "", fmt.Errorf("failed to upload object: %w", err)
+	}
+	return stagingKey, info.Size, hex.EncodeToString(hashWriter.Sum(nil)), nil
+}
+
+// Promote copies stagingKey to finalName and removes the staging object.
+// Only a CopyObject failure is treated as a Promote failure: once the copy
+// succeeds, finalName is live and that's what every caller actually relies
+// on. A RemoveObject failure just leaves a stale staging/ object behind,
+// so it's logged rather than turned into an error that would make the
+// caller believe finalName doesn't exist when it does.
+func (s *S3StorageProvider) Promote(ctx context.Context, stagingKey, finalName string) (string, error) {
+	dst := minio.CopyDestOptions{Bucket: s.bucket, Object: finalName}
+	src := minio.CopySrcOptions{Bucket: s.bucket, Object: stagingKey}
+	if _, err := s.client.CopyObject(ctx, dst, src); err != nil {
+		return "", fmt.Errorf("failed to promote staged object: %w", err)
+	}
+	if err := s.client.RemoveObject(ctx, s.bucket, stagingKey, minio.RemoveObjectOptions{}); err != nil {
+		log.Printf("failed to remove staged object %s after promoting to %s: %v", stagingKey, finalName, err)
+	}
+	return finalName, nil
+}
+
+func (s *S3StorageProvider) Discard(ctx context.Context, stagingKey string) error {
+	return s.client.RemoveObject(ctx, s.bucket, stagingKey, minio.RemoveObjectOptions{})
+}
+
+func (s *S3StorageProvider) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+}
+
+func (s *S3StorageProvider) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3StorageProvider) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{Size: info.Size, ModTime: info.LastModified}, nil
+}
+
+func (s *S3StorageProvider) PresignedURL(ctx context.Context, key, filename string) (string, error) {
+	reqParams := make(map[string][]string)
+	reqParams["response-content-disposition"] = []string{fmt.Sprintf("inline; filename=%s", filename)}
+
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, presignedURLExpiry, reqParams)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign object URL: %w", err)
+	}
+	return u.String(), nil
+}
+
+func (s *S3StorageProvider) Healthy(ctx context.Context) error {
+	_, err := s.client.BucketExists(ctx, s.bucket)
+	return err
+}
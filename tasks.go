@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/xid"
+	"gorm.io/gorm"
+)
+
+var taskService *TaskService
+
+// TASK_POLL_INTERVAL controls how often pollPending re-sweeps the tasks
+// table for pending rows that missed their non-blocking dispatch.
+var TASK_POLL_INTERVAL = time.Duration(getEnvInt("TASK_POLL_INTERVAL_SECONDS", 30)) * time.Second
+
+// TaskType identifies the kind of post-upload processing a job performs.
+type TaskType string
+
+const (
+	TaskTypeMimeCheck TaskType = "mime_check"
+	TaskTypeThumbnail TaskType = "thumbnail"
+	TaskTypeMetadata  TaskType = "metadata"
+	TaskTypeReplicate TaskType = "replicate"
+)
+
+// TaskStatus is the lifecycle state of a Task row.
+type TaskStatus string
+
+const (
+	TaskStatusPending TaskStatus = "pending"
+	TaskStatusRunning TaskStatus = "running"
+	TaskStatusDone    TaskStatus = "done"
+	TaskStatusFailed  TaskStatus = "failed"
+)
+
+// Task tracks a single unit of background work queued after an asset is
+// durably written, e.g. a MIME re-check or thumbnail generation.
+type Task struct {
+	ID         string     `json:"id" gorm:"type:varchar(20);primary_key"`
+	AssetID    string     `json:"assetId" gorm:"type:varchar(20);index;not null"`
+	Type       TaskType   `json:"type" gorm:"type:varchar(20);not null"`
+	Status     TaskStatus `json:"status" gorm:"type:varchar(20);not null;default:pending"`
+	RetryCount int        `json:"retryCount" gorm:"not null;default:0"`
+	LastError  string     `json:"lastError,omitempty"`
+	Result     string     `json:"result,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt  time.Time  `json:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// taskHandler runs the work for a single task. An error triggers a retry
+// (subject to the owning pool's RETRY_ limit) with exponential backoff.
+type taskHandler func(ctx context.Context, task *Task) (result string, err error)
+
+// workerPool runs up to `workers` concurrent handlers for a single
+// TaskType, retrying failed jobs up to maxRetries times.
+type workerPool struct {
+	taskType   TaskType
+	workers    int
+	maxRetries int
+	handler    taskHandler
+	jobs       chan string
+}
+
+func newWorkerPool(taskType TaskType, workers, maxRetries int, handler taskHandler) *workerPool {
+	return &workerPool{
+		taskType:   taskType,
+		workers:    workers,
+		maxRetries: maxRetries,
+		handler:    handler,
+		jobs:       make(chan string, 1000),
+	}
+}
+
+// dispatch hands id to a worker without ever blocking the caller. If
+// every worker is busy and the buffer is full, the task simply stays
+// pending in the database: pollPending sweeps for exactly this case, so
+// a backlog sheds load onto later polling instead of hanging whichever
+// goroutine (often an HTTP request handler) called Enqueue.
+func (p *workerPool) dispatch(id string) {
+	select {
+	case p.jobs <- id:
+	default:
+		log.Printf("task pool %s: queue full, deferring task %s to next poll", p.taskType, id)
+	}
+}
+
+// TaskService owns the tasks table and the per-type worker pools that
+// drain it.
+type TaskService struct {
+	db    *gorm.DB
+	pools map[TaskType]*workerPool
+}
+
+// NewTaskService migrates the tasks table and builds a worker pool for
+// each registered TaskType. Worker count and retry limits are read from
+// WORKERS_<TYPE> and RETRY_<TYPE> env vars (e.g. WORKERS_THUMBNAIL,
+// RETRY_THUMBNAIL), defaulting to 2 workers and 3 retries.
+func NewTaskService(db *gorm.DB) (*TaskService, error) {
+	if err := db.AutoMigrate(&Task{}); err != nil {
+		return nil, err
+	}
+
+	s := &TaskService{db: db, pools: make(map[TaskType]*workerPool)}
+	s.register(TaskTypeMimeCheck, "MIME_CHECK", mimeCheckJob)
+	s.register(TaskTypeThumbnail, "THUMBNAIL", thumbnailJob)
+	s.register(TaskTypeMetadata, "METADATA", metadataJob)
+
+	if STORAGE_DRIVER_REPLICA != "" {
+		s.register(TaskTypeReplicate, "REPLICATE", replicateJob)
+	}
+
+	return s, nil
+}
+
+func (s *TaskService) register(taskType TaskType, envPrefix string, handler taskHandler) {
+	workers := getEnvInt("WORKERS_"+envPrefix, 2)
+	maxRetries := getEnvInt("RETRY_"+envPrefix, 3)
+	s.pools[taskType] = newWorkerPool(taskType, workers, maxRetries, handler)
+}
+
+// Start launches every pool's worker goroutines, plus one pollPending
+// sweep per pool. It must be called once, after all pools have been
+// registered.
+func (s *TaskService) Start(ctx context.Context) {
+	for _, pool := range s.pools {
+		for i := 0; i < pool.workers; i++ {
+			go s.runWorker(ctx, pool)
+		}
+		go s.pollPending(ctx, pool)
+	}
+}
+
+// pollPending periodically re-dispatches tasks that are still pending in
+// the database, most commonly because Enqueue's non-blocking send found
+// the pool's buffer full. It's the backstop that keeps a backlog from
+// stalling forever once the buffer has room again.
+func (s *TaskService) pollPending(ctx context.Context, pool *workerPool) {
+	ticker := time.NewTicker(TASK_POLL_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var pending []Task
+			if err := s.db.Model(&Task{}).
+				Where("type = ? AND status = ?", pool.taskType, TaskStatusPending).
+				Order("created_at").
+				Find(&pending).Error; err != nil {
+				log.Printf("task pool %s: failed to poll pending tasks: %v", pool.taskType, err)
+				continue
+			}
+			for _, task := range pending {
+				pool.dispatch(task.ID)
+			}
+		}
+	}
+}
+
+func (s *TaskService) runWorker(ctx context.Context, pool *workerPool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id, ok := <-pool.jobs:
+			if !ok {
+				return
+			}
+			s.execute(ctx, pool, id)
+		}
+	}
+}
+
+// Enqueue creates a pending Task row for assetID and schedules it on the
+// pool for taskType. It is a no-op (returns nil, nil) when no pool is
+// registered for taskType, e.g. replication when no secondary storage
+// driver is configured.
+func (s *TaskService) Enqueue(taskType TaskType, assetID string) (*Task, error) {
+	pool, ok := s.pools[taskType]
+	if !ok {
+		return nil, nil
+	}
+
+	task := &Task{
+		ID:      xid.New().String(),
+		AssetID: assetID,
+		Type:    taskType,
+		Status:  TaskStatusPending,
+	}
+	if err := s.db.Create(task).Error; err != nil {
+		return nil, err
+	}
+
+	pool.dispatch(task.ID)
+	return task, nil
+}
+
+func (s *TaskService) execute(ctx context.Context, pool *workerPool, id string) {
+	// Claim the task atomically before running it: pollPending may have
+	// re-dispatched an id that a worker already picked up, and this
+	// conditional update ensures only one of the two duplicate sends
+	// actually runs the handler.
+	claim := s.db.Model(&Task{}).
+		Where("id = ? AND status = ?", id, TaskStatusPending).
+		UpdateColumn("status", TaskStatusRunning)
+	if claim.Error != nil {
+		log.Printf("task %s: failed to claim: %v", id, claim.Error)
+		return
+	}
+	if claim.RowsAffected == 0 {
+		return
+	}
+
+	var task Task
+	if err := s.db.First(&task, "id = ?", id).Error; err != nil {
+		log.Printf("task %s: failed to load: %v", id, err)
+		return
+	}
+
+	result, err := pool.handler(ctx, &task)
+	if err == nil {
+		s.db.Model(&Task{}).Where("id = ?", id).Updates(map[string]any{
+			"status": TaskStatusDone,
+			"result": result,
+		})
+		return
+	}
+
+	task.RetryCount++
+	if task.RetryCount > pool.maxRetries {
+		s.db.Model(&Task{}).Where("id = ?", id).Updates(map[string]any{
+			"status":      TaskStatusFailed,
+			"retry_count": task.RetryCount,
+			"last_error":  err.Error(),
+		})
+		return
+	}
+
+	s.db.Model(&Task{}).Where("id = ?", id).Updates(map[string]any{
+		"status":      TaskStatusPending,
+		"retry_count": task.RetryCount,
+		"last_error":  err.Error(),
+	})
+
+	backoff := time.Duration(1<<task.RetryCount) * time.Second
+	if backoff > time.Minute {
+		backoff = time.Minute
+	}
+	time.AfterFunc(backoff, func() {
+		pool.dispatch(id)
+	})
+}
+
+func (s *TaskService) getTask(id string) (*Task, error) {
+	var task Task
+	result := s.db.First(&task, "id = ?", id)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &task, nil
+}
+
+func (s *TaskService) listTasks(limit, offset int) ([]Task, error) {
+	var tasks []Task
+	result := s.db.Model(&Task{}).Order("created_at DESC").Limit(limit).Offset(offset).Find(&tasks)
+	return tasks, result.Error
+}
+
+func listTasksHandler(c *gin.Context) {
+	limit := 100
+	offset := 0
+
+	if limitParam := c.DefaultQuery("limit", ""); limitParam != "" {
+		parsedLimit, err := strconv.Atoi(limitParam)
+		if err == nil && parsedLimit > 0 && parsedLimit <= 1000 {
+			limit = parsedLimit
+		}
+	}
+	if offsetParam := c.DefaultQuery("offset", ""); offsetParam != "" {
+		parsedOffset, err := strconv.Atoi(offsetParam)
+		if err == nil && parsedOffset >= 0 {
+			offset = parsedOffset
+		}
+	}
+
+	tasks, err := taskService.listTasks(limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to list tasks"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"limit":   limit,
+		"offset":  offset,
+		"tasks":   tasks,
+	})
+}
+
+func getTaskHandler(c *gin.Context) {
+	task, err := taskService.getTask(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to retrieve task"))
+		return
+	}
+	if task == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse(404, "Task not found"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"task":    *task,
+	})
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+const thumbnailMaxWidth = 256
+
+// mimeCheckJob re-sniffs the stored asset, reading up to the mimetype
+// package's read limit rather than only the first 512 bytes inspected at
+// upload time; the rest of the body is not read. It flags a mismatch against the
+// stored MimeType. This is a magic-number consistency check only — it
+// does not run any virus/malware scanner (e.g. ClamAV), so its result
+// must not be read as an assurance that the content is safe.
+func mimeCheckJob(ctx context.Context, task *Task) (string, error) {
+	asset, err := assetService.getAssetByID(task.AssetID)
+	if err != nil {
+		return "", err
+	}
+	if asset == nil {
+		return "", fmt.Errorf("asset %s no longer exists", task.AssetID)
+	}
+
+	reader, err := assetService.storage.Open(ctx, asset.StoragePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open asset: %w", err)
+	}
+	defer reader.Close()
+
+	detected, err := mimetype.DetectReader(reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to scan asset: %w", err)
+	}
+
+	if detected.String() != asset.MimeType {
+		return fmt.Sprintf(`{"mimeMatch":false,"declaredMimeType":%q,"detectedMimeType":%q}`, asset.MimeType, detected.String()), nil
+	}
+	return `{"mimeMatch":true}`, nil
+}
+
+// thumbnailJob generates a downscaled preview for image/* assets and
+// records its storage key on the parent Asset so GET /assets/:name/thumbnail
+// can serve it. Output is encoded as JPEG: no pure-Go WebP encoder is
+// vendored here, and shelling out to a cgo-linked libwebp would make
+// this binary depend on a system library the other handlers don't need.
+func thumbnailJob(ctx context.Context, task *Task) (string, error) {
+	asset, err := assetService.getAssetByID(task.AssetID)
+	if err != nil {
+		return "", err
+	}
+	if asset == nil {
+		return "", fmt.Errorf("asset %s no longer exists", task.AssetID)
+	}
+	if !strings.HasPrefix(asset.MimeType, "image/") {
+		return `{"skipped":"not an image"}`, nil
+	}
+
+	reader, err := assetService.storage.Open(ctx, asset.StoragePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open asset: %w", err)
+	}
+	defer reader.Close()
+
+	src, _, err := image.Decode(reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	thumb := resizeToWidth(src, thumbnailMaxWidth)
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(jpeg.Encode(pw, thumb, &jpeg.Options{Quality: 80}))
+	}()
+
+	thumbName := task.AssetID + "_thumb.jpg"
+	stagingKey, size, _, err := assetService.storage.Stage(ctx, thumbName, pr)
+	if err != nil {
+		return "", fmt.Errorf("failed to stage thumbnail: %w", err)
+	}
+	key, err := assetService.storage.Promote(ctx, stagingKey, thumbName)
+	if err != nil {
+		return "", fmt.Errorf("failed to promote thumbnail: %w", err)
+	}
+	if err := assetService.setThumbnailPath(task.AssetID, key); err != nil {
+		return "", fmt.Errorf("failed to record thumbnail path: %w", err)
+	}
+
+	bounds := thumb.Bounds()
+	return fmt.Sprintf(`{"storagePath":%q,"width":%d,"height":%d,"size":%d}`, key, bounds.Dx(), bounds.Dy(), size), nil
+}
+
+// resizeToWidth returns a nearest-neighbor downscale of src to maxWidth,
+// preserving aspect ratio. It is a no-op if src is already narrower.
+func resizeToWidth(src image.Image, maxWidth int) image.Image {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	if srcW <= maxWidth {
+		return src
+	}
+
+	dstW := maxWidth
+	dstH := srcH * dstW / srcW
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		srcY := bounds.Min.Y + y*srcH/dstH
+		for x := 0; x < dstW; x++ {
+			srcX := bounds.Min.X + x*srcW/dstW
+			dst.Set(x, y, src.At(srcX, srcY))
+		}
+	}
+	return dst
+}
+
+// metadataJob runs ffprobe against video/* assets and stores its JSON
+// report as the task result. It requires an ffprobe binary on PATH.
+func metadataJob(ctx context.Context, task *Task) (string, error) {
+	asset, err := assetService.getAssetByID(task.AssetID)
+	if err != nil {
+		return "", err
+	}
+	if asset == nil {
+		return "", fmt.Errorf("asset %s no longer exists", task.AssetID)
+	}
+	if !strings.HasPrefix(asset.MimeType, "video/") {
+		return `{"skipped":"not a video"}`, nil
+	}
+
+	reader, err := assetService.storage.Open(ctx, asset.StoragePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open asset: %w", err)
+	}
+	defer reader.Close()
+
+	tmp, err := os.CreateTemp("", "rclone-assets-probe-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, reader); err != nil {
+		return "", fmt.Errorf("failed to buffer asset for probing: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "quiet", "-print_format", "json", "-show_format", "-show_streams", tmp.Name())
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("ffprobe failed: %w", err)
+	}
+	return string(out), nil
+}
+
+// replicateJob copies an asset's bytes to the secondary StorageProvider
+// configured via STORAGE_DRIVER_REPLICA.
+func replicateJob(ctx context.Context, task *Task) (string, error) {
+	asset, err := assetService.getAssetByID(task.AssetID)
+	if err != nil {
+		return "", err
+	}
+	if asset == nil {
+		return "", fmt.Errorf("asset %s no longer exists", task.AssetID)
+	}
+
+	reader, err := assetService.storage.Open(ctx, asset.StoragePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open asset: %w", err)
+	}
+	defer reader.Close()
+
+	stagingKey, _, _, err := replicaStorage.Stage(ctx, asset.FileName, reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to stage replica: %w", err)
+	}
+	key, err := replicaStorage.Promote(ctx, stagingKey, asset.FileName)
+	if err != nil {
+		return "", fmt.Errorf("failed to promote replica: %w", err)
+	}
+	return fmt.Sprintf(`{"replicaStoragePath":%q}`, key), nil
+}
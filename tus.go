@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/xid"
+	"gorm.io/gorm"
+)
+
+const (
+	TUS_RESUMABLE_VERSION = "1.0.0"
+	TUS_EXTENSIONS        = "creation,expiration,termination"
+	TUS_UPLOAD_EXPIRY     = 24 * time.Hour
+)
+
+var (
+	TUS_STAGING_PATH = getEnv("TUS_STAGING_PATH", filepath.Join(os.TempDir(), "rclone-assets-tus"))
+	TUS_MAX_SIZE     = int64(getEnvInt("TUS_MAX_SIZE", 10<<30)) // 10 GiB
+)
+
+var tusService *TusService
+
+// UploadSession tracks one in-progress tus.io resumable upload.
+type UploadSession struct {
+	ID          string    `json:"id" gorm:"type:varchar(20);primary_key"`
+	Offset      int64     `json:"offset" gorm:"not null;default:0"`
+	Length      int64     `json:"length" gorm:"not null"`
+	Metadata    string    `json:"metadata,omitempty"`
+	StagingPath string    `json:"-" gorm:"not null"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	CreatedAt   time.Time `json:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `json:"updatedAt" gorm:"autoUpdateTime"`
+}
+
+// TusService implements the tus.io resumable upload protocol (v1.0.0,
+// creation/expiration/termination extensions) on top of AssetService,
+// staging bytes on local disk until an upload is complete and then
+// promoting them through the normal upload pipeline (mimetype detection,
+// hashing and dedup).
+type TusService struct {
+	db *gorm.DB
+	mu sync.Map // session id -> *sync.Mutex, serializes PATCH per session
+}
+
+func NewTusService(db *gorm.DB) (*TusService, error) {
+	if err := db.AutoMigrate(&UploadSession{}); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(TUS_STAGING_PATH, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create tus staging directory: %w", err)
+	}
+	return &TusService{db: db}, nil
+}
+
+func (t *TusService) sessionLock(id string) *sync.Mutex {
+	actual, _ := t.mu.LoadOrStore(id, &sync.Mutex{})
+	return actual.(*sync.Mutex)
+}
+
+func (t *TusService) getSession(id string) (*UploadSession, error) {
+	var session UploadSession
+	result := t.db.First(&session, "id = ?", id)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &session, nil
+}
+
+// reapExpired periodically deletes upload sessions (and their staging
+// files) past their expiration, implementing the tus expiration extension.
+func (t *TusService) reapExpired(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var expired []UploadSession
+			if err := t.db.Where("expires_at < ?", time.Now().UTC()).Find(&expired).Error; err != nil {
+				log.Printf("tus: failed to query expired sessions: %v", err)
+				continue
+			}
+			for _, session := range expired {
+				os.Remove(session.StagingPath)
+				t.db.Delete(&UploadSession{}, "id = ?", session.ID)
+			}
+		}
+	}
+}
+
+func tusResumableHeaders(c *gin.Context) {
+	c.Header("Tus-Resumable", TUS_RESUMABLE_VERSION)
+}
+
+// createUploadHandler implements POST /files.
+func (t *TusService) createUploadHandler(c *gin.Context) {
+	tusResumableHeaders(c)
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse(400, "Missing or invalid Upload-Length header"))
+		return
+	}
+	if length > TUS_MAX_SIZE {
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse(413, "Upload-Length exceeds Tus-Max-Size"))
+		return
+	}
+
+	id := xid.New().String()
+	stagingPath := filepath.Join(TUS_STAGING_PATH, id)
+
+	f, err := os.Create(stagingPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to create upload session"))
+		return
+	}
+	f.Close()
+
+	session := &UploadSession{
+		ID:          id,
+		Length:      length,
+		Metadata:    c.GetHeader("Upload-Metadata"),
+		StagingPath: stagingPath,
+		ExpiresAt:   time.Now().UTC().Add(TUS_UPLOAD_EXPIRY),
+	}
+	if err := t.db.Create(session).Error; err != nil {
+		os.Remove(stagingPath)
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to create upload session"))
+		return
+	}
+
+	c.Header("Location", "/files/"+id)
+	c.Header("Upload-Expires", session.ExpiresAt.Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+// headUploadHandler implements HEAD /files/:id.
+func (t *TusService) headUploadHandler(c *gin.Context) {
+	tusResumableHeaders(c)
+
+	session, err := t.getSession(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to look up upload session"))
+		return
+	}
+	if session == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse(404, "Upload session not found"))
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(session.Length, 10))
+	c.Header("Upload-Expires", session.ExpiresAt.Format(http.TimeFormat))
+	if session.Metadata != "" {
+		c.Header("Upload-Metadata", session.Metadata)
+	}
+	c.Status(http.StatusOK)
+}
+
+// patchUploadHandler implements PATCH /files/:id, appending bytes at
+// Upload-Offset and, once Offset==Length, promoting the staged file into
+// a real Asset.
+func (t *TusService) patchUploadHandler(c *gin.Context) {
+	tusResumableHeaders(c)
+
+	if c.GetHeader("Content-Type") != "application/offset+octet-stream" {
+		c.JSON(http.StatusBadRequest, ErrorResponse(400, "Content-Type must be application/offset+octet-stream"))
+		return
+	}
+
+	id := c.Param("id")
+	lock := t.sessionLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	session, err := t.getSession(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to look up upload session"))
+		return
+	}
+	if session == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse(404, "Upload session not found"))
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset != session.Offset {
+		c.JSON(http.StatusConflict, ErrorResponse(409, "Upload-Offset does not match session offset"))
+		return
+	}
+
+	f, err := os.OpenFile(session.StagingPath, os.O_WRONLY, 0644)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to open staged upload"))
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to seek staged upload"))
+		return
+	}
+
+	written, err := io.Copy(f, io.LimitReader(c.Request.Body, session.Length-offset))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to write upload chunk"))
+		return
+	}
+
+	newOffset := offset + written
+	if err := t.db.Model(&UploadSession{}).Where("id = ?", id).Updates(map[string]any{
+		"offset":     newOffset,
+		"expires_at": time.Now().UTC().Add(TUS_UPLOAD_EXPIRY),
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to persist upload progress"))
+		return
+	}
+	session.Offset = newOffset
+
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+
+	if session.Offset < session.Length {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	asset, deduplicated, err := t.promote(c.Request.Context(), session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to finalize upload"))
+		return
+	}
+
+	os.Remove(session.StagingPath)
+	t.db.Delete(&UploadSession{}, "id = ?", id)
+
+	c.Header("Asset-Id", asset.ID)
+	if deduplicated {
+		c.Header("Asset-Deduplicated", "true")
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// terminateUploadHandler implements DELETE /files/:id, cancelling an
+// in-progress upload.
+func (t *TusService) terminateUploadHandler(c *gin.Context) {
+	tusResumableHeaders(c)
+
+	id := c.Param("id")
+	session, err := t.getSession(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to look up upload session"))
+		return
+	}
+	if session == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse(404, "Upload session not found"))
+		return
+	}
+
+	os.Remove(session.StagingPath)
+	if err := t.db.Delete(&UploadSession{}, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse(500, "Failed to delete upload session"))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// optionsUploadHandler advertises protocol support for tus discovery
+// requests.
+func (t *TusService) optionsUploadHandler(c *gin.Context) {
+	tusResumableHeaders(c)
+	c.Header("Tus-Version", TUS_RESUMABLE_VERSION)
+	c.Header("Tus-Max-Size", strconv.FormatInt(TUS_MAX_SIZE, 10))
+	c.Header("Tus-Extension", TUS_EXTENSIONS)
+	c.Status(http.StatusNoContent)
+}
+
+// promote runs mimetype detection and hashing over a completed staging
+// file, then hands off to finalizeStagedUpload for the dedup/promote/
+// enqueue tail shared with handleRawUpload and the LFS upload handler.
+func (t *TusService) promote(ctx context.Context, session *UploadSession) (*Asset, bool, error) {
+	f, err := os.Open(session.StagingPath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open staged upload: %w", err)
+	}
+	defer f.Close()
+
+	buffer := make([]byte, 512)
+	n, err := io.ReadFull(f, buffer)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, false, fmt.Errorf("failed to read staged upload: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, false, fmt.Errorf("failed to rewind staged upload: %w", err)
+	}
+
+	mtype := mimetype.Detect(buffer[:n])
+	assetID := xid.New().String()
+	destFileName := assetID + mtype.Extension()
+
+	stagingKey, size, fileHash, sha256Hash, err := assetService.stageWithDigests(ctx, destFileName, f)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to stage asset: %w", err)
+	}
+
+	asset := &Asset{
+		ID:       assetID,
+		FileName: destFileName,
+		Size:     size,
+		MimeType: mtype.String(),
+		Hash:     fileHash,
+		SHA256:   sha256Hash,
+		RefCount: 1,
+	}
+	return assetService.finalizeStagedUpload(ctx, stagingKey, asset)
+}